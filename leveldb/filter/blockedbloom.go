@@ -0,0 +1,120 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import "io"
+
+// cacheLineBits is the size, in bits, of the window that all k probes for
+// a single key are confined to. It matches a typical 64-byte CPU cache
+// line so that KeyMayMatch touches at most one cache line per key.
+const cacheLineBits = 512
+
+// BlockedBloomFilter is a bloom filter variant that partitions its bitmap
+// into cacheLineBits-sized blocks and confines all k probes for a given
+// key to a single block, trading a small increase in false-positive rate
+// for one cache miss per lookup instead of k.
+type BlockedBloomFilter struct {
+	bitsPerKey, k uint32
+}
+
+// NewBlockedBloomFilter create new initialized blocked bloom filter for
+// given bitsPerKey.
+func NewBlockedBloomFilter(bitsPerKey int) *BlockedBloomFilter {
+	k := uint32(bitsPerKey) * 69 / 100 // 0.69 =~ ln(2)
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	return &BlockedBloomFilter{uint32(bitsPerKey), k}
+}
+
+// Name return the name of this filter. i.e. "leveldb.CacheLineBloomFilter".
+func (*BlockedBloomFilter) Name() string {
+	return "leveldb.CacheLineBloomFilter"
+}
+
+// lineOf returns the index of the cache line that key is confined to,
+// given nLines available lines.
+func lineOf(h, nLines uint32) uint32 {
+	return h % nLines
+}
+
+// CreateFilter generate filter for given set of keys and write it to
+// given buffer.
+func (p *BlockedBloomFilter) CreateFilter(keys [][]byte, buf io.Writer) {
+	// Compute how many cache lines we need so that the lines together
+	// hold roughly bitsPerKey*n bits, i.e. about bitsPerKey*n/nLines
+	// bits worth of keys per line, rounded up to whole lines.
+	bits := uint32(len(keys)) * p.bitsPerKey
+	if bits < cacheLineBits {
+		bits = cacheLineBits
+	}
+
+	nLines := (bits + cacheLineBits - 1) / cacheLineBits
+	bytes := nLines * (cacheLineBits / 8)
+
+	array := make([]byte, bytes)
+
+	for _, key := range keys {
+		h := bloomHash(key)
+		line := lineOf(h, nLines)
+		base := line * (cacheLineBits / 8)
+
+		delta := (h >> 17) | (h << 15) // Rotate right 17 bits
+		for i := uint32(0); i < p.k; i++ {
+			bitpos := h % cacheLineBits
+			array[base+bitpos/8] |= (1 << (bitpos % 8))
+			h += delta
+		}
+	}
+
+	buf.Write(array)
+	buf.Write([]byte{byte(p.k)})
+	writeUint32LE(buf, nLines)
+}
+
+// KeyMayMatch test whether given key on the list.
+func (p *BlockedBloomFilter) KeyMayMatch(key, filter []byte) bool {
+	l := uint32(len(filter))
+	if l < 6 {
+		return false
+	}
+
+	k := uint32(filter[l-5])
+	if k > 30 {
+		return true
+	}
+
+	nLines := readUint32LE(filter[l-4:])
+	if nLines == 0 {
+		return false
+	}
+
+	h := bloomHash(key)
+	line := lineOf(h, nLines)
+	base := line * (cacheLineBits / 8)
+
+	delta := (h >> 17) | (h << 15) // Rotate right 17 bits
+	for i := uint32(0); i < k; i++ {
+		bitpos := h % cacheLineBits
+		if (uint32(filter[base+bitpos/8]) & (1 << (bitpos % 8))) == 0 {
+			return false
+		}
+		h += delta
+	}
+
+	return true
+}
+
+func writeUint32LE(buf io.Writer, v uint32) {
+	buf.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)})
+}
+
+func readUint32LE(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlockedBloomFilter_RoundTrip(t *testing.T) {
+	keys := make([][]byte, 500)
+	for i := range keys {
+		keys[i] = []byte{byte(i), byte(i >> 8)}
+	}
+
+	p := NewBlockedBloomFilter(10)
+	var buf bytes.Buffer
+	p.CreateFilter(keys, &buf)
+	data := buf.Bytes()
+
+	for _, key := range keys {
+		if !p.KeyMayMatch(key, data) {
+			t.Errorf("KeyMayMatch(%v) = false, want true (false negative)", key)
+		}
+	}
+}
+
+func TestBlockedBloomFilter_NameDiffersFromBuiltin(t *testing.T) {
+	// Name() must differ so a table reader can tell which decoder a
+	// filter block was built with and keep reading old SSTables with
+	// the unblocked decoder.
+	if (&BlockedBloomFilter{}).Name() == (&BloomFilter{}).Name() {
+		t.Error("BlockedBloomFilter.Name() must not equal BloomFilter.Name()")
+	}
+}
+
+func TestBlockedBloomFilter_MixedFilterCase(t *testing.T) {
+	keys := [][]byte{[]byte("alpha"), []byte("bravo")}
+
+	plain := NewBloomFilter(10)
+	var plainBuf bytes.Buffer
+	plain.CreateFilter(keys, &plainBuf)
+
+	blocked := NewBlockedBloomFilter(10)
+	var blockedBuf bytes.Buffer
+	blocked.CreateFilter(keys, &blockedBuf)
+
+	// Each policy correctly reads back only the filter block it wrote;
+	// a reader must pick the decoder matching the block's Name(),
+	// never assume a single shared format.
+	for _, key := range keys {
+		if !plain.KeyMayMatch(key, plainBuf.Bytes()) {
+			t.Errorf("BloomFilter.KeyMayMatch(%q) on its own block = false, want true", key)
+		}
+		if !blocked.KeyMayMatch(key, blockedBuf.Bytes()) {
+			t.Errorf("BlockedBloomFilter.KeyMayMatch(%q) on its own block = false, want true", key)
+		}
+	}
+}
@@ -14,11 +14,32 @@
 package filter
 
 import (
+	"errors"
 	"io"
+	"math"
 
 	"leveldb/hash"
 )
 
+// ErrFilterKMismatch is returned by Union when the given filters were
+// built with a different k (number of probes) and so cannot be merged.
+var ErrFilterKMismatch = errors.New("leveldb/filter: mismatched k")
+
+// ErrFilterHashMismatch is returned by Union when the given filters carry
+// different hash ids in their trailers. Bitwise-ORing bitmaps produced
+// by different hashes would silently corrupt membership for whichever
+// filter's hash doesn't match the result's trailer, so it is rejected
+// rather than merged. All filters built with NewBloomFilterWithHash share
+// the hashIDCustom id, so filters built with two different
+// caller-supplied functions are not told apart and are merged.
+var ErrFilterHashMismatch = errors.New("leveldb/filter: mismatched hash")
+
+// ErrFilterLengthMismatch is returned by Union when a given filter is
+// too short to be a real filter, carries the reserved k > 30 encoding,
+// or its bitmap length differs from the others, e.g. because it was
+// sized for a different number of keys.
+var ErrFilterLengthMismatch = errors.New("leveldb/filter: mismatched filter length")
+
 func bloomHash(key []byte) uint32 {
 	return hash.Hash(key, 0xbc9f1d34)
 }
@@ -26,6 +47,14 @@ func bloomHash(key []byte) uint32 {
 // BloomFilter filter represent a bloom filter.
 type BloomFilter struct {
 	bitsPerKey, k uint32
+
+	// hash is nil for filters built with NewBloomFilter/
+	// NewBloomFilterWithFPRate, in which case the package-level bloomHash
+	// (Murmur-variant) is used and the on-disk trailer stays the original
+	// single k byte. hashID identifies hash for the extended 3-byte
+	// trailer written when hash is non-nil.
+	hash   func([]byte) uint32
+	hashID byte
 }
 
 // NewBloomFilter create new initialized bloom filter for given
@@ -38,7 +67,66 @@ func NewBloomFilter(bitsPerKey int) *BloomFilter {
 	} else if k > 30 {
 		k = 30
 	}
-	return &BloomFilter{uint32(bitsPerKey), k}
+	return &BloomFilter{bitsPerKey: uint32(bitsPerKey), k: k}
+}
+
+// NewBloomFilterWithHash creates a new bloom filter for given bitsPerKey
+// that uses h instead of the built-in Murmur-variant hash to compute
+// probe positions. This lets callers opt into a different distribution
+// or collision-resistance trade-off (see NewXXHash32BloomFilter and
+// NewSipHash24BloomFilter for built-in alternatives) without forking the
+// package.
+//
+// Filters built this way are encoded with an extended 3-byte trailer
+// (k, a hash id, then the fixed extendedTrailerMarker byte) so that
+// KeyMayMatch can tell them apart from the original 1-byte-trailer
+// filters produced by NewBloomFilter, where the trailing byte is k
+// itself and is always <= 30.
+func NewBloomFilterWithHash(bitsPerKey int, h func([]byte) uint32) *BloomFilter {
+	k := uint32(bitsPerKey) * 69 / 100 // 0.69 =~ ln(2)
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	return &BloomFilter{bitsPerKey: uint32(bitsPerKey), k: k, hash: h, hashID: hashIDCustom}
+}
+
+// NewBloomFilterWithFPRate create new initialized bloom filter for the
+// given target false-positive rate, e.g. 0.01 for 1%. It derives
+// bitsPerKey from fpRate alone and picks k accordingly; expectedKeys does
+// not affect the result, since CreateFilter sizes each filter from the
+// number of keys it is given. k is
+// clamped to [1,30] so the result stays compatible with the trailing byte
+// used to persist k in CreateFilter/KeyMayMatch.
+func NewBloomFilterWithFPRate(expectedKeys int, fpRate float64) *BloomFilter {
+	// bitsPerKey =~ -log2(fpRate) / ln(2) =~ -1.44 * log2(fpRate)
+	bitsPerKey := math.Ceil(-1.44 * math.Log2(fpRate))
+
+	k := uint32(math.Round(bitsPerKey * math.Ln2))
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	return &BloomFilter{bitsPerKey: uint32(bitsPerKey), k: k}
+}
+
+// EstimateFPRate returns the expected false-positive rate of this filter
+// configuration once it holds numKeys entries, computed as
+// (1 - e^(-k*n/m))^k where m is the number of bits that CreateFilter would
+// allocate for numKeys keys. Callers can use this to sanity-check a
+// bitsPerKey/k configuration before inserting data.
+func (p *BloomFilter) EstimateFPRate(numKeys int) float64 {
+	bits := float64(numKeys) * float64(p.bitsPerKey)
+	if bits < 64 {
+		bits = 64
+	}
+	bits = math.Ceil(bits/8) * 8
+
+	k := float64(p.k)
+	n := float64(numKeys)
+	return math.Pow(1-math.Exp(-k*n/bits), k)
 }
 
 // Name return the name of this filter. i.e. "leveldb.BuiltinBloomFilter".
@@ -46,6 +134,15 @@ func (*BloomFilter) Name() string {
 	return "leveldb.BuiltinBloomFilter"
 }
 
+// hashFunc returns the hash function this filter was constructed with,
+// falling back to the built-in Murmur-variant.
+func (p *BloomFilter) hashFunc() func([]byte) uint32 {
+	if p.hash != nil {
+		return p.hash
+	}
+	return bloomHash
+}
+
 // CreateFilter generate filter for given set of keys and write it to
 // given buffer.
 func (p *BloomFilter) CreateFilter(keys [][]byte, buf io.Writer) {
@@ -62,11 +159,12 @@ func (p *BloomFilter) CreateFilter(keys [][]byte, buf io.Writer) {
 	bits = bytes * 8
 
 	array := make([]byte, bytes)
+	hash := p.hashFunc()
 
 	for _, key := range keys {
 		// Use double-hashing to generate a sequence of hash values.
 		// See analysis in [Kirsch,Mitzenmacher 2006].
-		h := bloomHash(key)
+		h := hash(key)
 		delta := (h >> 17) | (h << 15) // Rotate right 17 bits
 		for i := uint32(0); i < p.k; i++ {
 			bitpos := h % bits
@@ -77,31 +175,89 @@ func (p *BloomFilter) CreateFilter(keys [][]byte, buf io.Writer) {
 
 	buf.Write(array)
 	buf.Write([]byte{byte(p.k)})
+	if p.hash != nil {
+		// Extended trailer: k (above), the hash id, then the fixed
+		// extendedTrailerMarker byte. The marker -- not merely "> 30"
+		// -- is what KeyMayMatch keys off of, so the original format's
+		// full k > 30 "reserved, always match" range stays available
+		// for genuinely unknown future encodings instead of being
+		// silently swallowed by this one.
+		buf.Write([]byte{p.hashID, extendedTrailerMarker})
+	}
 }
 
 // KeyMayMatch test whether given key on the list.
 func (p *BloomFilter) KeyMayMatch(key, filter []byte) bool {
+	bitmap, k, hashID, ok := decodeBloomTrailer(filter)
+	if !ok {
+		// Either too short to be a real filter, or a reserved k value
+		// used by the format to mean "always match".
+		return len(filter) >= 2
+	}
+
+	hash, found := builtinHashes[hashID]
+	if !found {
+		// Default hash (hashID 0), or an arbitrary caller-supplied
+		// function that isn't in the registry -- fall back to the hash
+		// this instance was constructed with.
+		hash = p.hashFunc()
+	}
+	return probeBloom(hash, key, bitmap, k)
+}
+
+// extendedTrailerMarker is the fixed trailing byte that identifies the
+// 3-byte extended trailer ([k][hashID][extendedTrailerMarker]) written
+// for filters built with NewBloomFilterWithHash. It is a single
+// dedicated value rather than "any byte > 30" so that the rest of the
+// original format's reserved k > 30 "always match" range (see
+// KeyMayMatch/decodeBloomTrailer) is left untouched for other, truly
+// unknown encodings -- a legacy filter can only be mis-decoded as an
+// extended trailer if its trailing byte happens to equal this exact
+// marker, which NewBloomFilter/NewBloomFilterWithFPRate never produce
+// since they always clamp k to [1,30].
+const extendedTrailerMarker = 255
+
+// decodeBloomTrailer splits filter into its bitmap and parses the k and
+// hashID encoded in its trailer, handling both the original 1-byte
+// trailer (trailing byte is k itself, hashID 0) and the extended
+// 3-byte trailer written for non-default hashes (k, hashID, then the
+// fixed extendedTrailerMarker byte). ok is false if filter is too short
+// to hold a trailer, or if it carries the reserved k > 30 "always
+// match" encoding.
+func decodeBloomTrailer(filter []byte) (bitmap []byte, k uint32, hashID byte, ok bool) {
 	l := uint32(len(filter))
 	if l < 2 {
-		return false
+		return nil, 0, 0, false
 	}
 
-	bits := (l - 1) * 8
+	if filter[l-1] == extendedTrailerMarker && l >= 3 {
+		kb := filter[l-3]
+		if kb > 30 {
+			return nil, 0, 0, false
+		}
+		return filter[:l-3], uint32(kb), filter[l-2], true
+	}
 
-	// Use the encoded k so that we can read filters generated by
-	// bloom filters created using different parameters.
-	k := uint32(filter[l-1])
-	if k > 30 {
-		// Reserved for potentially new encodings for short bloom filters.
-		// Consider it a match.
-		return true
+	last := filter[l-1]
+	if last <= 30 {
+		return filter[:l-1], uint32(last), 0, true
 	}
 
-	h := bloomHash(key)
+	// Reserved for potentially new encodings; callers treat this as
+	// "always match".
+	return nil, 0, 0, false
+}
+
+// probeBloom runs the standard double-hashing probe sequence for key
+// against bitmap using hash, testing k bits.
+func probeBloom(hash func([]byte) uint32, key, bitmap []byte, k uint32) bool {
+	bits := uint32(len(bitmap)) * 8
+
+	h := hash(key)
 	delta := (h >> 17) | (h << 15) // Rotate right 17 bits
 	for i := uint32(0); i < k; i++ {
 		bitpos := h % bits
-		if (uint32(filter[bitpos/8]) & (1 << (bitpos % 8))) == 0 {
+		if (uint32(bitmap[bitpos/8]) & (1 << (bitpos % 8))) == 0 {
 			return false
 		}
 		h += delta
@@ -109,3 +265,52 @@ func (p *BloomFilter) KeyMayMatch(key, filter []byte) bool {
 
 	return true
 }
+
+// Union bitwise-ORs the bitmaps of one or more filters built by this
+// BloomFilter configuration (same bitsPerKey, and same k as read from
+// each filter's own trailer) into a single filter covering the union of
+// their key sets. This lets compaction reuse existing filter blocks
+// instead of rehashing every key when the tables being merged were
+// built with the same filter configuration and so produced
+// same-length, same-k filters.
+//
+// Filters with a mismatched k are rejected with ErrFilterKMismatch;
+// filters with different hash ids in their trailers are rejected with
+// ErrFilterHashMismatch; filters that are too short, carry the reserved
+// k > 30 encoding, or have a mismatched bitmap length are rejected with
+// ErrFilterLengthMismatch.
+func (p *BloomFilter) Union(filters ...[]byte) ([]byte, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	bitmap0, k0, hashID0, ok := decodeBloomTrailer(filters[0])
+	if !ok {
+		return nil, ErrFilterLengthMismatch
+	}
+
+	out := make([]byte, len(bitmap0))
+	copy(out, bitmap0)
+
+	for _, filter := range filters[1:] {
+		bitmap, k, hashID, ok := decodeBloomTrailer(filter)
+		if !ok || len(bitmap) != len(out) {
+			return nil, ErrFilterLengthMismatch
+		}
+		if k != k0 {
+			return nil, ErrFilterKMismatch
+		}
+		if hashID != hashID0 {
+			return nil, ErrFilterHashMismatch
+		}
+		for i, b := range bitmap {
+			out[i] |= b
+		}
+	}
+
+	out = append(out, byte(k0))
+	if hashID0 != 0 {
+		out = append(out, hashID0, extendedTrailerMarker)
+	}
+	return out, nil
+}
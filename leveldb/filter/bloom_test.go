@@ -0,0 +1,154 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBloomFilter_RoundTrip(t *testing.T) {
+	keys := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charlie")}
+
+	p := NewBloomFilter(10)
+	var buf bytes.Buffer
+	p.CreateFilter(keys, &buf)
+	data := buf.Bytes()
+
+	for _, key := range keys {
+		if !p.KeyMayMatch(key, data) {
+			t.Errorf("KeyMayMatch(%q) = false, want true (false negative)", key)
+		}
+	}
+	if p.KeyMayMatch([]byte("not-in-the-set"), data) {
+		t.Log("KeyMayMatch(absent key) = true; false positives are allowed, just noting it happened")
+	}
+}
+
+func TestBloomFilter_ReservedKAlwaysMatches(t *testing.T) {
+	p := NewBloomFilter(10)
+	// A trailing byte > 30 that isn't the extended-trailer marker is
+	// reserved for unknown future encodings and must be treated as an
+	// unconditional match.
+	reserved := append(make([]byte, 8), 200)
+	if !p.KeyMayMatch([]byte("anything"), reserved) {
+		t.Error("KeyMayMatch with reserved k > 30 = false, want true")
+	}
+}
+
+func TestNewBloomFilterWithFPRate(t *testing.T) {
+	p := NewBloomFilterWithFPRate(1000, 0.01)
+	if p.k != 7 {
+		t.Errorf("k = %d, want 7 for fpRate=0.01 (bitsPerKey=%d)", p.k, p.bitsPerKey)
+	}
+
+	if got := p.EstimateFPRate(1000); got > 0.02 {
+		t.Errorf("EstimateFPRate(1000) = %v, want roughly <= 0.01 target", got)
+	}
+}
+
+func TestBloomFilterWithHash_RoundTrip(t *testing.T) {
+	keys := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charlie")}
+
+	for _, p := range []*BloomFilter{
+		NewXXHash32BloomFilter(10),
+		NewSipHash24BloomFilter(10),
+		NewBloomFilterWithHash(10, bloomHash),
+	} {
+		var buf bytes.Buffer
+		p.CreateFilter(keys, &buf)
+		data := buf.Bytes()
+
+		for _, key := range keys {
+			if !p.KeyMayMatch(key, data) {
+				t.Errorf("KeyMayMatch(%q) = false, want true (false negative)", key)
+			}
+		}
+	}
+}
+
+func TestBloomFilterWithHash_DistinctFromLegacyTrailer(t *testing.T) {
+	p := NewXXHash32BloomFilter(10)
+	var buf bytes.Buffer
+	p.CreateFilter([][]byte{[]byte("alpha")}, &buf)
+	data := buf.Bytes()
+
+	if data[len(data)-1] != extendedTrailerMarker {
+		t.Fatalf("trailing byte = %d, want extendedTrailerMarker (%d)", data[len(data)-1], extendedTrailerMarker)
+	}
+
+	legacy := NewBloomFilter(10)
+	if !legacy.KeyMayMatch([]byte("alpha"), data) {
+		t.Error("a BloomFilter instance decoding another instance's extended-trailer filter must look up the encoded hash id and still find the key")
+	}
+}
+
+func TestBloomFilter_Union(t *testing.T) {
+	p := NewBloomFilter(10)
+
+	buf1 := createFilterBytes(p, [][]byte{[]byte("a"), []byte("b")})
+	buf2 := createFilterBytes(p, [][]byte{[]byte("c"), []byte("d")})
+
+	merged, err := p.Union(buf1, buf2)
+	if err != nil {
+		t.Fatalf("Union() error = %v", err)
+	}
+	for _, key := range [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")} {
+		if !p.KeyMayMatch(key, merged) {
+			t.Errorf("Union result KeyMayMatch(%q) = false, want true", key)
+		}
+	}
+}
+
+func TestBloomFilter_UnionRejectsMismatchedK(t *testing.T) {
+	p10 := NewBloomFilter(10)
+	p20 := NewBloomFilter(20)
+
+	buf1 := createFilterBytes(p10, [][]byte{[]byte("a")})
+	buf2 := createFilterBytes(p20, [][]byte{[]byte("b")})
+
+	if _, err := p10.Union(buf1, buf2); err != ErrFilterKMismatch {
+		t.Errorf("Union() error = %v, want ErrFilterKMismatch", err)
+	}
+}
+
+func TestBloomFilter_UnionRejectsMismatchedHash(t *testing.T) {
+	pDefault := NewBloomFilter(10)
+	pXX := NewXXHash32BloomFilter(10)
+
+	buf1 := createFilterBytes(pDefault, [][]byte{[]byte("a"), []byte("b")})
+	buf2 := createFilterBytes(pXX, [][]byte{[]byte("c"), []byte("d")})
+
+	if _, err := pDefault.Union(buf1, buf2); err != ErrFilterHashMismatch {
+		t.Errorf("Union() error = %v, want ErrFilterHashMismatch", err)
+	}
+}
+
+func TestBloomFilter_UnionRejectsMismatchedLength(t *testing.T) {
+	p := NewBloomFilter(10)
+
+	buf1 := createFilterBytes(p, [][]byte{[]byte("a")})
+	buf2 := createFilterBytes(p, bigKeySet())
+
+	if _, err := p.Union(buf1, buf2); err != ErrFilterLengthMismatch {
+		t.Errorf("Union() error = %v, want ErrFilterLengthMismatch", err)
+	}
+}
+
+func createFilterBytes(p *BloomFilter, keys [][]byte) []byte {
+	var buf bytes.Buffer
+	p.CreateFilter(keys, &buf)
+	return buf.Bytes()
+}
+
+func bigKeySet() [][]byte {
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = []byte{byte(i), byte(i >> 8)}
+	}
+	return keys
+}
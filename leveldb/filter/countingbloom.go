@@ -0,0 +1,183 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import "errors"
+
+// ErrInvalidCountingBloomFilter is returned by UnmarshalBinary when the
+// encoded data is too short, carries an unsupported counter width, or
+// holds a number of counter bytes that does not match its slot count.
+var ErrInvalidCountingBloomFilter = errors.New("leveldb/filter: invalid counting bloom filter data")
+
+// CountingBloomFilter is a bloom filter backed by an array of small
+// saturating counters instead of single bits, so that keys can be
+// removed as well as added. It uses the same bloomHash double-hashing
+// scheme as BloomFilter, so the two types generate the same sequence of
+// probe hashes for a given key (each reduced modulo its own slot count);
+// only the bit-test-and-set is replaced by a counter
+// increment/decrement.
+//
+// Unlike BloomFilter, CountingBloomFilter is a live, mutable structure
+// meant to be built incrementally via Add/Remove/Contains rather than
+// produced once via CreateFilter.
+type CountingBloomFilter struct {
+	counters    []byte // packed counters, counterBits per slot
+	m           uint32 // number of counters
+	k           uint32
+	counterBits uint32 // 4 or 8
+	maxCount    byte
+}
+
+// NewCountingBloomFilter creates a new counting bloom filter sized for
+// numSlots counters with k probes per key. counterBits selects the width
+// of each counter, either 4 (the default, two counters packed per byte)
+// or 8 (one counter per byte, allowing more deletions before saturating).
+func NewCountingBloomFilter(numSlots, k, counterBits int) *CountingBloomFilter {
+	if counterBits != 4 && counterBits != 8 {
+		counterBits = 4
+	}
+	if k < 1 {
+		k = 1
+	}
+
+	m := uint32(numSlots)
+	if m < 1 {
+		m = 1
+	}
+
+	nbytes := (m*uint32(counterBits) + 7) / 8
+	return &CountingBloomFilter{
+		counters:    make([]byte, nbytes),
+		m:           m,
+		k:           uint32(k),
+		counterBits: uint32(counterBits),
+		maxCount:    byte(1<<uint(counterBits) - 1),
+	}
+}
+
+// positions returns the k counter indexes that key maps to.
+func (p *CountingBloomFilter) positions(key []byte) []uint32 {
+	h := bloomHash(key)
+	delta := (h >> 17) | (h << 15) // Rotate right 17 bits
+	pos := make([]uint32, p.k)
+	for i := uint32(0); i < p.k; i++ {
+		pos[i] = h % p.m
+		h += delta
+	}
+	return pos
+}
+
+func (p *CountingBloomFilter) get(idx uint32) byte {
+	if p.counterBits == 8 {
+		return p.counters[idx]
+	}
+	b := p.counters[idx/2]
+	if idx%2 == 0 {
+		return b & 0x0f
+	}
+	return b >> 4
+}
+
+func (p *CountingBloomFilter) set(idx uint32, v byte) {
+	if p.counterBits == 8 {
+		p.counters[idx] = v
+		return
+	}
+	b := p.counters[idx/2]
+	if idx%2 == 0 {
+		p.counters[idx/2] = (b & 0xf0) | (v & 0x0f)
+	} else {
+		p.counters[idx/2] = (b & 0x0f) | (v << 4)
+	}
+}
+
+// Add inserts key into the filter, incrementing each of its k counters
+// (saturating at the counter's maximum value).
+func (p *CountingBloomFilter) Add(key []byte) {
+	for _, idx := range p.positions(key) {
+		if c := p.get(idx); c < p.maxCount {
+			p.set(idx, c+1)
+		}
+	}
+}
+
+// Remove deletes key from the filter, decrementing each of its k
+// counters. Removing a key that was never added (or removing it more
+// times than it was added) corrupts the filter for other keys sharing
+// those counters, so callers must only remove keys they know were added.
+func (p *CountingBloomFilter) Remove(key []byte) {
+	for _, idx := range p.positions(key) {
+		// A saturated counter no longer knows how many keys it counts,
+		// so it is left as is rather than decremented.
+		if c := p.get(idx); c > 0 && c < p.maxCount {
+			p.set(idx, c-1)
+		}
+	}
+}
+
+// Contains test whether key may be in the set. As with any bloom
+// filter, false positives are possible but false negatives are not,
+// provided Remove is never called more often than Add for a given key.
+func (p *CountingBloomFilter) Contains(key []byte) bool {
+	for _, idx := range p.positions(key) {
+		if p.get(idx) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the filter so it can be persisted alongside a
+// table or checkpoint. The layout is: 1 byte counterBits, 4 bytes m
+// (little-endian), 4 bytes k (little-endian), followed by the packed
+// counter bytes.
+func (p *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 9+len(p.counters))
+	out[0] = byte(p.counterBits)
+	putUint32LE(out[1:5], p.m)
+	putUint32LE(out[5:9], p.k)
+	copy(out[9:], p.counters)
+	return out, nil
+}
+
+// UnmarshalBinary decodes a filter previously produced by MarshalBinary,
+// replacing the receiver's contents.
+func (p *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 9 {
+		return ErrInvalidCountingBloomFilter
+	}
+
+	counterBits := uint32(data[0])
+	if counterBits != 4 && counterBits != 8 {
+		return ErrInvalidCountingBloomFilter
+	}
+
+	m := readUint32LE(data[1:5])
+	k := readUint32LE(data[5:9])
+
+	nbytes := (m*counterBits + 7) / 8
+	if uint32(len(data)-9) != nbytes {
+		return ErrInvalidCountingBloomFilter
+	}
+
+	counters := make([]byte, nbytes)
+	copy(counters, data[9:])
+
+	p.counters = counters
+	p.m = m
+	p.k = k
+	p.counterBits = counterBits
+	p.maxCount = byte(1<<uint(counterBits) - 1)
+	return nil
+}
+
+func putUint32LE(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import "testing"
+
+func TestCountingBloomFilter_AddContainsRemove(t *testing.T) {
+	p := NewCountingBloomFilter(1024, 4, 4)
+
+	keys := [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charlie")}
+	for _, key := range keys {
+		p.Add(key)
+	}
+	for _, key := range keys {
+		if !p.Contains(key) {
+			t.Errorf("Contains(%q) = false after Add, want true (false negative)", key)
+		}
+	}
+
+	p.Remove([]byte("bravo"))
+	if p.Contains([]byte("bravo")) {
+		t.Error("Contains(bravo) = true after Remove, want false")
+	}
+	if !p.Contains([]byte("alpha")) {
+		t.Error("Contains(alpha) = false after removing an unrelated key, want true")
+	}
+}
+
+func TestCountingBloomFilter_MarshalUnmarshal(t *testing.T) {
+	for _, counterBits := range []int{4, 8} {
+		p := NewCountingBloomFilter(256, 4, counterBits)
+		keys := [][]byte{[]byte("alpha"), []byte("bravo")}
+		for _, key := range keys {
+			p.Add(key)
+		}
+
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("counterBits=%d: MarshalBinary() error = %v", counterBits, err)
+		}
+
+		q := &CountingBloomFilter{}
+		if err := q.UnmarshalBinary(data); err != nil {
+			t.Fatalf("counterBits=%d: UnmarshalBinary() error = %v", counterBits, err)
+		}
+
+		for _, key := range keys {
+			if !q.Contains(key) {
+				t.Errorf("counterBits=%d: Contains(%q) = false after round trip, want true", counterBits, key)
+			}
+		}
+	}
+}
+
+func TestCountingBloomFilter_UnmarshalInvalid(t *testing.T) {
+	q := &CountingBloomFilter{}
+	if err := q.UnmarshalBinary([]byte{1, 2, 3}); err != ErrInvalidCountingBloomFilter {
+		t.Errorf("UnmarshalBinary(too short) error = %v, want ErrInvalidCountingBloomFilter", err)
+	}
+}
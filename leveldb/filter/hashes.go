@@ -0,0 +1,188 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package filter
+
+import "encoding/binary"
+
+// Hash ids for the built-in alternative hashes, used to make the
+// extended trailer self-describing across BloomFilter instances.
+// hashIDCustom marks a filter built with an arbitrary caller-supplied
+// hash function, which cannot be looked up by id alone.
+const (
+	hashIDXXHash32  = 1
+	hashIDSipHash24 = 2
+	hashIDCustom    = 224
+)
+
+// builtinHashes maps a hash-id read from an extended trailer back to the
+// hash function that produced it.
+var builtinHashes = map[byte]func([]byte) uint32{
+	hashIDXXHash32:  XXHash32,
+	hashIDSipHash24: SipHash24,
+}
+
+// NewXXHash32BloomFilter creates a bloom filter that uses xxHash32
+// instead of the built-in Murmur-variant hash. xxHash32 is faster than
+// Murmur and has better avalanche behaviour, at the cost of not being
+// designed to resist adversarial (hash-flooding) inputs.
+func NewXXHash32BloomFilter(bitsPerKey int) *BloomFilter {
+	p := NewBloomFilterWithHash(bitsPerKey, XXHash32)
+	p.hashID = hashIDXXHash32
+	return p
+}
+
+// NewSipHash24BloomFilter creates a bloom filter that uses SipHash-2-4
+// instead of the built-in Murmur-variant hash. SipHash is designed to
+// resist hash-flooding attacks, where an adversary picks keys that
+// collide under a known hash, at some throughput cost relative to
+// Murmur or xxHash32. SipHash24 here runs under the fixed sipKey0/sipKey1
+// key, which is the same for every filter and public in this package, so
+// filters built with it do not resist an adversary who knows that key.
+func NewSipHash24BloomFilter(bitsPerKey int) *BloomFilter {
+	p := NewBloomFilterWithHash(bitsPerKey, SipHash24)
+	p.hashID = hashIDSipHash24
+	return p
+}
+
+const (
+	xxPrime1 uint32 = 2654435761
+	xxPrime2 uint32 = 2246822519
+	xxPrime3 uint32 = 3266489917
+	xxPrime4 uint32 = 668265263
+	xxPrime5 uint32 = 374761393
+)
+
+// XXHash32 computes the xxHash32 checksum of key with a zero seed.
+func XXHash32(key []byte) uint32 {
+	n := len(key)
+	var h uint32
+	i := 0
+
+	if n >= 16 {
+		var v1 uint32 = xxPrime1
+		v1 += xxPrime2
+		v2 := xxPrime2
+		v3 := uint32(0)
+		var v4 uint32
+		v4 -= xxPrime1
+
+		for ; i+16 <= n; i += 16 {
+			v1 = xxRound(v1, le32(key[i:]))
+			v2 = xxRound(v2, le32(key[i+4:]))
+			v3 = xxRound(v3, le32(key[i+8:]))
+			v4 = xxRound(v4, le32(key[i+12:]))
+		}
+		h = rotl32(v1, 1) + rotl32(v2, 7) + rotl32(v3, 12) + rotl32(v4, 18)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint32(n)
+
+	for ; i+4 <= n; i += 4 {
+		h += le32(key[i:]) * xxPrime3
+		h = rotl32(h, 17) * xxPrime4
+	}
+
+	for ; i < n; i++ {
+		h += uint32(key[i]) * xxPrime5
+		h = rotl32(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxPrime2
+	h ^= h >> 13
+	h *= xxPrime3
+	h ^= h >> 16
+
+	return h
+}
+
+func xxRound(acc, input uint32) uint32 {
+	acc += input * xxPrime2
+	acc = rotl32(acc, 13)
+	acc *= xxPrime1
+	return acc
+}
+
+func rotl32(x uint32, r uint) uint32 {
+	return (x << r) | (x >> (32 - r))
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// sipKey0 and sipKey1 are a fixed internal SipHash key. bloomHash already
+// uses a fixed seed (0xbc9f1d34) rather than a per-process random one, so
+// SipHash24 follows the same convention here: the key is not chosen
+// per-instance or per-process, and anyone who reads it can compute
+// SipHash24 for any key.
+const (
+	sipKey0 uint64 = 0x0706050403020100
+	sipKey1 uint64 = 0x0f0e0d0c0b0a0908
+)
+
+// SipHash24 computes the low 32 bits of the SipHash-2-4 checksum of key
+// under a fixed internal key.
+func SipHash24(key []byte) uint32 {
+	v0 := sipKey0 ^ 0x736f6d6570736575
+	v1 := sipKey1 ^ 0x646f72616e646f6d
+	v2 := sipKey0 ^ 0x6c7967656e657261
+	v3 := sipKey1 ^ 0x7465646279746573
+
+	n := len(key)
+	end := n - (n % 8)
+
+	for i := 0; i < end; i += 8 {
+		m := binary.LittleEndian.Uint64(key[i : i+8])
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+
+	last := uint64(n&0xff) << 56
+	for i := n - 1; i >= end; i-- {
+		last |= uint64(key[i]) << uint(8*(i-end))
+	}
+
+	v3 ^= last
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= last
+
+	v2 ^= 0xff
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+
+	return uint32(v0 ^ v1 ^ v2 ^ v3)
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = rotl64(v1, 13)
+	v1 ^= v0
+	v0 = rotl64(v0, 32)
+	v2 += v3
+	v3 = rotl64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = rotl64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = rotl64(v1, 17)
+	v1 ^= v2
+	v2 = rotl64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+func rotl64(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}